@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/go-git/go-billy/v5"
+	"github.com/gofrs/flock"
 	"github.com/spf13/afero"
 )
 
@@ -20,6 +21,11 @@ const (
 type Billy struct {
 	afero afero.Afero
 	root  string
+
+	// realLocking is true when the wrapped afero.Fs hands back real OS
+	// files, so Lock/Unlock take a cross-process flock instead of falling
+	// back to an in-process mutex. See Capabilities.
+	realLocking bool
 }
 
 // New returns a billy filesystem backed by an input afero filesystem.
@@ -29,9 +35,17 @@ func New(fs afero.Fs) billy.Filesystem {
 		afero: afero.Afero{
 			Fs: fs,
 		},
+		realLocking: isOSBacked(fs),
 	}
 }
 
+// isOSBacked reports whether fs hands back real OS files, i.e. whether
+// flock-based locking is actually possible for files opened through it.
+func isOSBacked(fs afero.Fs) bool {
+	_, ok := fs.(*afero.OsFs)
+	return ok
+}
+
 // Create creates the named file with mode 0666 (before umask), truncating
 // it if it already exists. If successful, methods on the returned File can
 // be used for I/O; the associated file descriptor has mode O_RDWR.
@@ -62,7 +76,7 @@ func (fs *Billy) OpenFile(filename string, flag int, perm os.FileMode) (billy.Fi
 		return nil, err
 	}
 
-	return &file{File: f}, err
+	return newFile(f), err
 }
 
 // Stat returns a FileInfo describing the named file.
@@ -111,7 +125,7 @@ func (fs *Billy) TempFile(dir, prefix string) (billy.File, error) {
 		return nil, err
 	}
 
-	return &file{File: f}, nil
+	return newFile(f), nil
 }
 
 // ReadDir reads the directory named by dirname and returns a list of
@@ -173,6 +187,7 @@ func (fs *Billy) Chroot(basePath string) (billy.Filesystem, error) {
 		afero: afero.Afero{
 			Fs: afero.NewBasePathFs(fs.afero.Fs, basePath),
 		},
+		realLocking: fs.realLocking,
 	}, nil
 }
 
@@ -187,26 +202,82 @@ func (fs *Billy) RemoveAll(filePath string) error {
 	return fs.afero.Fs.RemoveAll(path.Clean(filePath))
 }
 
-// Capabilities implements the Capable interface.
+// Capabilities implements the Capable interface. LockCapability is omitted
+// when the wrapped afero.Fs isn't OS-backed, since Lock/Unlock then fall
+// back to an in-process mutex that only serializes goroutines, not the
+// cross-process advisory locking callers of LockCapability expect.
 func (fs *Billy) Capabilities() billy.Capability {
+	if !fs.realLocking {
+		return billy.DefaultCapabilities &^ billy.LockCapability
+	}
 	return billy.DefaultCapabilities
 }
 
-// file is a wrapper for an os.File which adds support for file locking.
+// fdFile is implemented by *os.File, which is what afero's OsFs hands back
+// as an afero.File. It's used to detect whether a file is backed by a real
+// OS file descriptor that flock(2)/LockFileEx can lock.
+type fdFile interface {
+	Fd() uintptr
+}
+
+// file is a wrapper for an afero.File which adds support for file locking.
+// When the underlying file is a real OS file, Lock/Unlock take an OS-level
+// advisory lock via gofrs/flock, which correctly serializes other
+// processes (not just goroutines) touching the same path. Otherwise, for
+// in-memory or other non-OS afero backends, locking falls back to an
+// in-process sync.Mutex.
 type file struct {
 	afero.File
-	m sync.Mutex
+	m     sync.Mutex
+	flock *flock.Flock
+}
+
+// newFile wraps f, detecting whether it's backed by a real OS file so Lock
+// can use flock instead of the in-process mutex fallback.
+func newFile(f afero.File) *file {
+	w := &file{File: f}
+
+	// Chroot wraps the afero.Fs in a BasePathFs, whose files hide the
+	// underlying *os.File and strip the base path from Name; look through
+	// them to reach the real OS file and its full path.
+	inner := f
+	for {
+		bp, ok := inner.(*afero.BasePathFile)
+		if !ok {
+			break
+		}
+		inner = bp.File
+	}
+
+	if _, ok := inner.(fdFile); ok {
+		if name := inner.Name(); name != "" {
+			if _, err := os.Stat(name); err == nil {
+				w.flock = flock.New(name)
+			}
+		}
+	}
+
+	return w
 }
 
-//Lock locks the file like e.g. flock. It protects against access from
-// other processes.
+// Lock locks the file like e.g. flock. It protects against access from
+// other processes when the file is backed by a real OS file; otherwise it
+// falls back to an in-process mutex.
 func (f *file) Lock() error {
+	if f.flock != nil {
+		return f.flock.Lock()
+	}
+
 	f.m.Lock()
 	return nil
 }
 
 // Unlock unlocks the file.
 func (f *file) Unlock() error {
+	if f.flock != nil {
+		return f.flock.Unlock()
+	}
+
 	f.m.Unlock()
 	return nil
 }
@@ -0,0 +1,215 @@
+package afero2billy
+
+import (
+	"os"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// Fallback implements a billy filesystem that stacks several billy
+// filesystems on top of each other, inspired by ocis' fsx fallback layer.
+// Reads try each filesystem in order and return the first hit; writes
+// always target the first one.
+type Fallback struct {
+	fss []billy.Filesystem
+}
+
+// NewFallback returns a billy filesystem backed by fss, tried in order.
+// Read operations (Open, Stat, Lstat, ReadDir, Readlink) return the first
+// non-os.ErrNotExist result across fss. Write operations (Create, OpenFile
+// with O_CREATE, MkdirAll, Symlink, Rename, Remove, RemoveAll, TempFile)
+// always target fss[0]. This is cheaper than NewOverlay when the caller
+// doesn't need copy-on-write bookkeeping, e.g. stacking an on-disk asset
+// directory on top of an embedded filesystem.
+func NewFallback(fss ...billy.Filesystem) billy.Filesystem {
+	if len(fss) == 0 {
+		panic("afero2billy: NewFallback requires at least one filesystem")
+	}
+	return &Fallback{fss: fss}
+}
+
+// primary returns the filesystem that write operations target.
+func (fs *Fallback) primary() billy.Filesystem {
+	return fs.fss[0]
+}
+
+// Create creates the named file in the primary filesystem, truncating it
+// if it already exists.
+func (fs *Fallback) Create(filename string) (billy.File, error) {
+	return fs.primary().Create(filename)
+}
+
+// Open opens the named file for reading, trying each filesystem in order
+// and returning the first one that has it.
+func (fs *Fallback) Open(filename string) (billy.File, error) {
+	return fs.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile is the generalized open call. With O_CREATE set, it always
+// targets the primary filesystem; otherwise it tries each filesystem in
+// order and returns the first non-os.ErrNotExist result.
+func (fs *Fallback) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if flag&os.O_CREATE != 0 {
+		return fs.primary().OpenFile(filename, flag, perm)
+	}
+
+	var err error
+	for _, candidate := range fs.fss {
+		var f billy.File
+		f, err = candidate.OpenFile(filename, flag, perm)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Stat returns a FileInfo describing the named file, trying each
+// filesystem in order.
+func (fs *Fallback) Stat(filename string) (os.FileInfo, error) {
+	var err error
+	for _, candidate := range fs.fss {
+		var fi os.FileInfo
+		fi, err = candidate.Stat(filename)
+		if err == nil {
+			return fi, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Rename renames oldpath to newpath in the primary filesystem.
+func (fs *Fallback) Rename(oldpath, newpath string) error {
+	return fs.primary().Rename(oldpath, newpath)
+}
+
+// Remove removes the named file or directory from the primary filesystem.
+func (fs *Fallback) Remove(filename string) error {
+	return fs.primary().Remove(filename)
+}
+
+// Join joins any number of path elements into a single path.
+func (fs *Fallback) Join(elem ...string) string {
+	return fs.primary().Join(elem...)
+}
+
+// TempFile creates a new temporary file in the primary filesystem.
+func (fs *Fallback) TempFile(dir, prefix string) (billy.File, error) {
+	return fs.primary().TempFile(dir, prefix)
+}
+
+// ReadDir reads the directory named by dirname, merging entries across all
+// filesystems and deduplicating by name with the first filesystem to list
+// a given name winning.
+func (fs *Fallback) ReadDir(dirname string) ([]os.FileInfo, error) {
+	seen := make(map[string]bool)
+	var entries []os.FileInfo
+	var lastErr error
+	found := false
+
+	for _, candidate := range fs.fss {
+		list, err := candidate.ReadDir(dirname)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+
+		for _, fi := range list {
+			if seen[fi.Name()] {
+				continue
+			}
+			seen[fi.Name()] = true
+			entries = append(entries, fi)
+		}
+	}
+
+	if !found {
+		return nil, lastErr
+	}
+
+	return entries, nil
+}
+
+// MkdirAll creates a directory named path, along with any necessary
+// parents, in the primary filesystem.
+func (fs *Fallback) MkdirAll(filename string, perm os.FileMode) error {
+	return fs.primary().MkdirAll(filename, perm)
+}
+
+// Lstat returns a FileInfo describing the named file without following a
+// trailing symlink, trying each filesystem in order.
+func (fs *Fallback) Lstat(filename string) (os.FileInfo, error) {
+	var err error
+	for _, candidate := range fs.fss {
+		var fi os.FileInfo
+		fi, err = candidate.Lstat(filename)
+		if err == nil {
+			return fi, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Symlink creates a symbolic link from link to target in the primary
+// filesystem.
+func (fs *Fallback) Symlink(target, link string) error {
+	return fs.primary().Symlink(target, link)
+}
+
+// Readlink returns the target path of link, trying each filesystem in
+// order.
+func (fs *Fallback) Readlink(link string) (string, error) {
+	var err error
+	for _, candidate := range fs.fss {
+		var target string
+		target, err = candidate.Readlink(link)
+		if err == nil {
+			return target, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+// Chroot returns a new Fallback filesystem with every wrapped filesystem
+// chrooted to basePath.
+func (fs *Fallback) Chroot(basePath string) (billy.Filesystem, error) {
+	chrooted := make([]billy.Filesystem, len(fs.fss))
+	for i, candidate := range fs.fss {
+		c, err := candidate.Chroot(basePath)
+		if err != nil {
+			return nil, err
+		}
+		chrooted[i] = c
+	}
+	return &Fallback{fss: chrooted}, nil
+}
+
+// Root returns the root path of the primary filesystem.
+func (fs *Fallback) Root() string {
+	return fs.primary().Root()
+}
+
+// RemoveAll removes a directory path and any children it contains from the
+// primary filesystem.
+func (fs *Fallback) RemoveAll(filePath string) error {
+	return billyRemoveAll(fs.primary(), filePath)
+}
+
+// Capabilities implements the Capable interface, delegating to the primary
+// filesystem.
+func (fs *Fallback) Capabilities() billy.Capability {
+	return billy.Capabilities(fs.primary())
+}
@@ -0,0 +1,212 @@
+package afero2billy
+
+import (
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// Filtered implements a billy filesystem that hides files whose basenames
+// don't satisfy a pair of include/exclude regular expressions, modeled on
+// afero's RegexpFs. Directory traversal is left unrestricted so callers can
+// still walk the tree to find the files that do match.
+type Filtered struct {
+	inner   billy.Filesystem
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// NewFiltered returns a billy filesystem wrapping inner that only exposes
+// files whose basename matches include (if non-nil) and doesn't match
+// exclude (if non-nil). Filtered-out paths behave as if they don't exist.
+// Directories are always visible so that tree traversal keeps working;
+// only their filtered contents are hidden.
+func NewFiltered(inner billy.Filesystem, include, exclude *regexp.Regexp) billy.Filesystem {
+	return &Filtered{inner: inner, include: include, exclude: exclude}
+}
+
+// matches reports whether name satisfies the include/exclude pair.
+func (fs *Filtered) matches(name string) bool {
+	base := path.Base(name)
+	if fs.include != nil && !fs.include.MatchString(base) {
+		return false
+	}
+	if fs.exclude != nil && fs.exclude.MatchString(base) {
+		return false
+	}
+	return true
+}
+
+// Create creates the named file, failing if it wouldn't be visible once
+// created.
+func (fs *Filtered) Create(filename string) (billy.File, error) {
+	if !fs.matches(filename) {
+		return nil, os.ErrNotExist
+	}
+	return fs.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, defaultCreateMode)
+}
+
+// Open opens the named file for reading if it matches the filter.
+func (fs *Filtered) Open(filename string) (billy.File, error) {
+	return fs.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile is the generalized open call. Filtered-out paths are rejected
+// with os.ErrNotExist unless O_CREATE is set, mirroring RegexpFs.
+func (fs *Filtered) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if flag&os.O_CREATE == 0 && !fs.matches(filename) {
+		return nil, os.ErrNotExist
+	}
+	return fs.inner.OpenFile(filename, flag, perm)
+}
+
+// Stat returns a FileInfo describing the named file, if it matches the
+// filter. Directories are returned whether or not they match.
+func (fs *Filtered) Stat(filename string) (os.FileInfo, error) {
+	fi, err := fs.inner.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() && !fs.matches(filename) {
+		return nil, os.ErrNotExist
+	}
+	return fi, nil
+}
+
+// Rename renames oldpath to newpath, if oldpath matches the filter.
+func (fs *Filtered) Rename(oldpath, newpath string) error {
+	if !fs.matches(oldpath) {
+		return os.ErrNotExist
+	}
+	return fs.inner.Rename(oldpath, newpath)
+}
+
+// Remove removes the named file, if it matches the filter.
+func (fs *Filtered) Remove(filename string) error {
+	if !fs.matches(filename) {
+		return os.ErrNotExist
+	}
+	return fs.inner.Remove(filename)
+}
+
+// Join joins any number of path elements into a single path.
+func (fs *Filtered) Join(elem ...string) string {
+	return fs.inner.Join(elem...)
+}
+
+// TempFile creates a new temporary file in dir. Filtering doesn't apply,
+// since the generated name is never known in advance.
+func (fs *Filtered) TempFile(dir, prefix string) (billy.File, error) {
+	return fs.inner.TempFile(dir, prefix)
+}
+
+// ReadDir reads the directory named by dirname and drops any entries whose
+// name doesn't match the filter. Directory operations themselves are left
+// unrestricted, so dirname need not match.
+func (fs *Filtered) ReadDir(dirname string) ([]os.FileInfo, error) {
+	entries, err := fs.inner.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := entries[:0]
+	for _, fi := range entries {
+		if fi.IsDir() || fs.matches(fi.Name()) {
+			filtered = append(filtered, fi)
+		}
+	}
+
+	return filtered, nil
+}
+
+// MkdirAll creates a directory named path, along with any necessary
+// parents. Directory operations are unrestricted by the filter.
+func (fs *Filtered) MkdirAll(filename string, perm os.FileMode) error {
+	return fs.inner.MkdirAll(filename, perm)
+}
+
+// Lstat returns a FileInfo describing the named file without following a
+// trailing symlink, if it matches the filter. Directories are returned
+// whether or not they match.
+func (fs *Filtered) Lstat(filename string) (os.FileInfo, error) {
+	fi, err := fs.inner.Lstat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() && !fs.matches(filename) {
+		return nil, os.ErrNotExist
+	}
+	return fi, nil
+}
+
+// Symlink creates a symbolic link from link to target. Filtering doesn't
+// apply to creation.
+func (fs *Filtered) Symlink(target, link string) error {
+	return fs.inner.Symlink(target, link)
+}
+
+// Readlink returns the target path of link, if it matches the filter.
+func (fs *Filtered) Readlink(link string) (string, error) {
+	if !fs.matches(link) {
+		return "", os.ErrNotExist
+	}
+	return fs.inner.Readlink(link)
+}
+
+// Chroot returns a new Filtered filesystem wrapping the inner filesystem's
+// Chroot, keeping the same include/exclude filter.
+func (fs *Filtered) Chroot(basePath string) (billy.Filesystem, error) {
+	inner, err := fs.inner.Chroot(basePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Filtered{inner: inner, include: fs.include, exclude: fs.exclude}, nil
+}
+
+// Root returns the root path of the filesystem.
+func (fs *Filtered) Root() string {
+	return fs.inner.Root()
+}
+
+// RemoveAll removes a directory path and any children it contains.
+// filePath itself is a directory operation and so is left unrestricted by
+// the filter, like MkdirAll and ReadDir's traversal; only file entries
+// encountered along the way are subject to the filter, and a filtered-out
+// file is left untouched rather than reported as missing.
+func (fs *Filtered) RemoveAll(filePath string) error {
+	fi, err := fs.inner.Lstat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.IsDir() {
+		entries, err := fs.inner.ReadDir(filePath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && !fs.matches(entry.Name()) {
+				continue
+			}
+			if err := fs.RemoveAll(path.Join(filePath, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = fs.inner.Remove(filePath)
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Capabilities implements the Capable interface, delegating to inner.
+func (fs *Filtered) Capabilities() billy.Capability {
+	return billy.Capabilities(fs.inner)
+}
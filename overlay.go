@@ -0,0 +1,348 @@
+package afero2billy
+
+import (
+	"io"
+	"os"
+	"path"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// Overlay implements a copy-on-write billy filesystem backed by two other
+// billy filesystems, modeled on afero's CopyOnWriteFs/UnionFile pair. Reads
+// fall through to base when a path is absent from layer, while every write
+// or creation lands in layer.
+type Overlay struct {
+	base  billy.Filesystem
+	layer billy.Filesystem
+	root  string
+}
+
+// NewOverlay returns a billy filesystem that composes base and layer: base
+// is treated as read-only, layer receives all writes and creations, and
+// files are copied up from base into layer the first time they're opened
+// for writing. Removing a file records a whiteout in layer so it no longer
+// appears to come from base, even though base is untouched.
+func NewOverlay(base, layer billy.Filesystem) billy.Filesystem {
+	return &Overlay{base: base, layer: layer, root: "/"}
+}
+
+const whiteoutSuffix = ".whiteout"
+
+// Create creates the named file in the overlay, truncating it if it
+// already exists there.
+func (fs *Overlay) Create(filename string) (billy.File, error) {
+	return fs.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, defaultCreateMode)
+}
+
+// Open opens the named file for reading, preferring the overlay and
+// falling back to base when it isn't there (and hasn't been whited out).
+func (fs *Overlay) Open(filename string) (billy.File, error) {
+	return fs.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile is the generalized open call. Opening for write always targets
+// the overlay, copying the file up from base first if it only exists
+// there. Opening for read prefers the overlay, falling back to base.
+func (fs *Overlay) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if fs.whitedOut(filename) && flag&os.O_CREATE == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	writing := flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE) != 0
+	if writing {
+		if err := fs.copyUp(filename); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		fs.clearWhiteout(filename)
+
+		f, err := fs.layer.OpenFile(filename, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return &overlayFile{File: f, fs: fs, name: filename}, nil
+	}
+
+	if f, err := fs.layer.OpenFile(filename, flag, perm); err == nil {
+		return &overlayFile{File: f, fs: fs, name: filename}, nil
+	}
+
+	f, err := fs.base.OpenFile(filename, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &overlayFile{File: f, fs: fs, name: filename}, nil
+}
+
+// copyUp copies filename from base into layer if it exists in base and not
+// already in layer. It is a no-op if the file is already present in layer.
+// A whited-out filename is treated as absent from base, even though base
+// itself is never touched by a whiteout: base's copy was "removed" and
+// must not be resurrected by a later write or rename.
+func (fs *Overlay) copyUp(filename string) error {
+	if _, err := fs.layer.Stat(filename); err == nil {
+		return nil
+	}
+
+	if fs.whitedOut(filename) {
+		return os.ErrNotExist
+	}
+
+	src, err := fs.base.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := fs.base.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	dst, err := fs.layer.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// Stat returns a FileInfo describing the named file, preferring the
+// overlay and falling back to base.
+func (fs *Overlay) Stat(filename string) (os.FileInfo, error) {
+	if fs.whitedOut(filename) {
+		return nil, os.ErrNotExist
+	}
+	if fi, err := fs.layer.Stat(filename); err == nil {
+		return fi, nil
+	}
+	return fs.base.Stat(filename)
+}
+
+// Rename renames oldpath to newpath, copying oldpath up into the overlay
+// first if it only exists in base.
+func (fs *Overlay) Rename(oldpath, newpath string) error {
+	if err := fs.copyUp(oldpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := fs.layer.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	fs.clearWhiteout(newpath)
+	return fs.whiteout(oldpath)
+}
+
+// Remove removes the named file. If it exists in base, a whiteout is
+// recorded in overlay so it no longer appears to exist; base is never
+// modified.
+func (fs *Overlay) Remove(filename string) error {
+	layerErr := fs.layer.Remove(filename)
+	if layerErr != nil && !os.IsNotExist(layerErr) {
+		return layerErr
+	}
+
+	if _, err := fs.base.Stat(filename); err == nil {
+		return fs.whiteout(filename)
+	}
+
+	return layerErr
+}
+
+// Join joins any number of path elements into a single path.
+func (fs *Overlay) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// TempFile creates a new temporary file in the overlay.
+func (fs *Overlay) TempFile(dir, prefix string) (billy.File, error) {
+	f, err := fs.layer.TempFile(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &overlayFile{File: f, fs: fs, name: f.Name()}, nil
+}
+
+// ReadDir merges the entries of dirname from both layers, deduplicated by
+// name with the overlay winning, and drops any base entries hidden by a
+// whiteout.
+func (fs *Overlay) ReadDir(dirname string) ([]os.FileInfo, error) {
+	seen := make(map[string]bool)
+	var entries []os.FileInfo
+
+	layerEntries, layerErr := fs.layer.ReadDir(dirname)
+	for _, fi := range layerEntries {
+		if isWhiteout(fi.Name()) {
+			seen[whiteoutTarget(fi.Name())] = true
+			continue
+		}
+		seen[fi.Name()] = true
+		entries = append(entries, fi)
+	}
+
+	baseEntries, baseErr := fs.base.ReadDir(dirname)
+	for _, fi := range baseEntries {
+		if seen[fi.Name()] {
+			continue
+		}
+		entries = append(entries, fi)
+	}
+
+	if layerErr != nil && baseErr != nil {
+		return nil, layerErr
+	}
+
+	return entries, nil
+}
+
+// MkdirAll creates dirname, along with any necessary parents, in the
+// overlay.
+func (fs *Overlay) MkdirAll(filename string, perm os.FileMode) error {
+	return fs.layer.MkdirAll(filename, perm)
+}
+
+// Lstat returns a FileInfo describing the named file without following a
+// trailing symlink, preferring the overlay and falling back to base.
+func (fs *Overlay) Lstat(filename string) (os.FileInfo, error) {
+	if fs.whitedOut(filename) {
+		return nil, os.ErrNotExist
+	}
+	if fi, err := fs.layer.Lstat(filename); err == nil {
+		return fi, nil
+	}
+	return fs.base.Lstat(filename)
+}
+
+// Symlink creates a symbolic link from link to target in the overlay.
+func (fs *Overlay) Symlink(target, link string) error {
+	if err := fs.layer.Symlink(target, link); err != nil {
+		return err
+	}
+	fs.clearWhiteout(link)
+	return nil
+}
+
+// Readlink returns the target path of link, preferring the overlay and
+// falling back to base.
+func (fs *Overlay) Readlink(link string) (string, error) {
+	if target, err := fs.layer.Readlink(link); err == nil {
+		return target, nil
+	}
+	return fs.base.Readlink(link)
+}
+
+// Chroot returns a new overlay filesystem rooted at basePath in both
+// layers.
+func (fs *Overlay) Chroot(basePath string) (billy.Filesystem, error) {
+	base, err := fs.base.Chroot(basePath)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := fs.layer.Chroot(basePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Overlay{base: base, layer: layer, root: path.Join(fs.root, basePath)}, nil
+}
+
+// Root returns the root path of the filesystem.
+func (fs *Overlay) Root() string {
+	return fs.root
+}
+
+// RemoveAll removes a directory path and any children it contains from the
+// overlay, whiting it out so base's copy is hidden too.
+func (fs *Overlay) RemoveAll(filePath string) error {
+	if err := billyRemoveAll(fs.layer, filePath); err != nil {
+		return err
+	}
+	if _, err := fs.base.Stat(filePath); err == nil {
+		return fs.whiteout(filePath)
+	}
+	return nil
+}
+
+// Capabilities implements the Capable interface.
+func (fs *Overlay) Capabilities() billy.Capability {
+	return billy.DefaultCapabilities
+}
+
+func (fs *Overlay) whiteoutPath(filename string) string {
+	return path.Join(path.Dir(filename), path.Base(filename)+whiteoutSuffix)
+}
+
+func (fs *Overlay) whiteout(filename string) error {
+	f, err := fs.layer.Create(fs.whiteoutPath(filename))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (fs *Overlay) clearWhiteout(filename string) {
+	_ = fs.layer.Remove(fs.whiteoutPath(filename))
+}
+
+func (fs *Overlay) whitedOut(filename string) bool {
+	_, err := fs.layer.Stat(fs.whiteoutPath(filename))
+	return err == nil
+}
+
+func isWhiteout(name string) bool {
+	return len(name) > len(whiteoutSuffix) && name[len(name)-len(whiteoutSuffix):] == whiteoutSuffix
+}
+
+func whiteoutTarget(name string) string {
+	return name[:len(name)-len(whiteoutSuffix)]
+}
+
+// overlayFile wraps a billy.File opened against either layer, transparently
+// reopening against the overlay layer on the first write if it was
+// originally opened read-only against base, preserving the current seek
+// offset.
+type overlayFile struct {
+	billy.File
+	fs   *Overlay
+	name string
+}
+
+// Write promotes the file to the overlay layer on first write if it was
+// opened against base, preserving the current seek offset, then writes p.
+func (f *overlayFile) Write(p []byte) (int, error) {
+	if err := f.promote(); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+// promote reopens the file against the overlay layer, copying it up from
+// base first, if it isn't already backed by the overlay layer.
+func (f *overlayFile) promote() error {
+	if _, err := f.fs.layer.Stat(f.name); err == nil {
+		return nil
+	}
+
+	offset, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if err := f.fs.copyUp(f.name); err != nil {
+		return err
+	}
+
+	promoted, err := f.fs.layer.OpenFile(f.name, os.O_RDWR, defaultCreateMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := promoted.Seek(offset, io.SeekStart); err != nil {
+		promoted.Close()
+		return err
+	}
+
+	f.File.Close()
+	f.File = promoted
+	return nil
+}
@@ -0,0 +1,52 @@
+package afero2billy
+
+import (
+	"os"
+	"path"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// removeAllOptional is the optional RemoveAll extension that some
+// billy.Filesystem implementations (e.g. osfs) expose, mirroring the
+// interface go-billy's own util.RemoveAll type-asserts for internally.
+// billy.Filesystem itself has no RemoveAll method, so wrappers that need
+// to recurse into another billy.Filesystem can't call it directly.
+type removeAllOptional interface {
+	RemoveAll(string) error
+}
+
+// billyRemoveAll removes path and any children it contains from fs. If fs
+// implements removeAllOptional, that's used directly; otherwise it's
+// emulated with a manual walk-and-remove.
+func billyRemoveAll(fs billy.Filesystem, p string) error {
+	if r, ok := fs.(removeAllOptional); ok {
+		return r.RemoveAll(p)
+	}
+
+	fi, err := fs.Lstat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.IsDir() {
+		entries, err := fs.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := billyRemoveAll(fs, path.Join(p, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = fs.Remove(p)
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
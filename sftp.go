@@ -0,0 +1,237 @@
+package afero2billy
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/sftpfs"
+)
+
+// lockFileSuffix is appended to a path to obtain the name of its advisory
+// lockfile fallback. github.com/pkg/sftp's client has no locking extension
+// of its own, so this fallback is the only locking strategy SFTP uses.
+const lockFileSuffix = ".lock"
+
+// SFTP implements a go-billy filesystem backed by an SFTP connection. Unlike
+// Billy, it talks to the SFTP client directly for operations where Afero's
+// interfaces can't express SFTP-specific semantics (symlinks, lstat, server
+// side locking), and only uses the wrapped afero.Fs for the common I/O path.
+type SFTP struct {
+	client *sftp.Client
+	afero  afero.Afero
+	root   string
+}
+
+// NewSFTP returns a billy filesystem backed by an SFTP connection, rooted at
+// root. Unlike Billy's Chroot, it is not built on afero.NewBasePathFs: root is
+// prepended to every path sent to the server, so a malicious or buggy
+// "../../etc/passwd" can never escape the root on the wire.
+func NewSFTP(client *sftp.Client, root string) billy.Filesystem {
+	return &SFTP{
+		client: client,
+		root:   path.Clean(root),
+		afero: afero.Afero{
+			Fs: sftpfs.New(client),
+		},
+	}
+}
+
+// join prepends the filesystem root to name and cleans the result. Unlike a
+// bare path.Join, it never returns a path outside fs.root: path.Clean alone
+// would happily collapse a "../../etc/passwd" straight past the root, which
+// is the exact escape NewSFTP's server-side prefixing is meant to prevent.
+// Any attempt to climb above the root is clamped back to the root itself.
+func (fs *SFTP) join(name string) string {
+	joined := path.Join(fs.root, name)
+	if fs.root == "/" {
+		return joined
+	}
+	if joined != fs.root && !strings.HasPrefix(joined, fs.root+"/") {
+		return fs.root
+	}
+	return joined
+}
+
+// Create creates the named file with mode 0666 (before umask), truncating
+// it if it already exists. If successful, methods on the returned File can
+// be used for I/O; the associated file descriptor has mode O_RDWR.
+func (fs *SFTP) Create(filename string) (billy.File, error) {
+	return fs.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, defaultCreateMode)
+}
+
+// Open opens the named file for reading. If successful, methods on the
+// returned file can be used for reading; the associated file descriptor has
+// mode O_RDONLY.
+func (fs *SFTP) Open(filename string) (billy.File, error) {
+	return fs.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile is the generalized open call; most users will use Open or Create
+// instead. It opens the named file with specified flag (O_RDONLY etc.) and
+// perm, (0666 etc.) if applicable. If successful, methods on the returned
+// File can be used for I/O.
+func (fs *SFTP) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	fullpath := fs.join(filename)
+
+	if flag&os.O_CREATE != 0 {
+		if err := fs.createDir(fullpath); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := fs.afero.Fs.OpenFile(fullpath, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpFile{file: file{File: f}, client: fs.client, path: fullpath}, nil
+}
+
+// Stat returns a FileInfo describing the named file, following symlinks.
+func (fs *SFTP) Stat(filename string) (os.FileInfo, error) {
+	return fs.client.Stat(fs.join(filename))
+}
+
+// Rename renames (moves) oldpath to newpath. If newpath already exists and
+// is not a directory, Rename replaces it.
+func (fs *SFTP) Rename(oldpath, newpath string) error {
+	fullNewpath := fs.join(newpath)
+	if err := fs.createDir(fullNewpath); err != nil {
+		return err
+	}
+	return fs.client.Rename(fs.join(oldpath), fullNewpath)
+}
+
+// Remove removes the named file or directory.
+func (fs *SFTP) Remove(filename string) error {
+	return fs.client.Remove(fs.join(filename))
+}
+
+// Join joins any number of path elements into a single path, adding a
+// Separator if necessary. Join calls path.Clean on the result.
+func (fs *SFTP) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// TempFile creates a new temporary file in the directory dir with a name
+// beginning with prefix, opens the file for reading and writing, and
+// returns the resulting File.
+func (fs *SFTP) TempFile(dir, prefix string) (billy.File, error) {
+	fulldir := fs.join(dir)
+	if err := fs.createDir(fulldir + "/"); err != nil {
+		return nil, err
+	}
+
+	f, err := fs.afero.TempFile(fulldir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpFile{file: file{File: f}, client: fs.client, path: f.Name()}, nil
+}
+
+// ReadDir reads the directory named by dirname and returns a list of
+// directory entries sorted by filename.
+func (fs *SFTP) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return fs.afero.ReadDir(fs.join(dirname))
+}
+
+// MkdirAll creates a directory named path, along with any necessary
+// parents, and returns nil, or else returns an error.
+func (fs *SFTP) MkdirAll(filename string, perm os.FileMode) error {
+	return fs.afero.Fs.MkdirAll(fs.join(filename), perm)
+}
+
+// Lstat returns a FileInfo describing the named file. If the file is a
+// symbolic link, the returned FileInfo describes the symbolic link itself,
+// fetched straight from the server so it never follows the link.
+func (fs *SFTP) Lstat(filename string) (os.FileInfo, error) {
+	return fs.client.Lstat(fs.join(filename))
+}
+
+// Symlink creates a symbolic-link from link to target on the remote server.
+// target may be an absolute or relative path, and need not refer to an
+// existing node. Parent directories of link are created as necessary.
+func (fs *SFTP) Symlink(target, link string) error {
+	fullLink := fs.join(link)
+	if err := fs.createDir(fullLink); err != nil {
+		return err
+	}
+
+	return fs.client.Symlink(target, fullLink)
+}
+
+// Readlink returns the target path of link, as reported by the server.
+func (fs *SFTP) Readlink(link string) (string, error) {
+	return fs.client.ReadLink(fs.join(link))
+}
+
+// Chroot returns a new SFTP filesystem whose root is basePath joined onto
+// the current root. Because paths are prefixed server-side on every
+// request rather than rewritten locally, "../" segments in subsequent calls
+// cannot walk back out past the new root.
+func (fs *SFTP) Chroot(basePath string) (billy.Filesystem, error) {
+	return &SFTP{
+		client: fs.client,
+		root:   fs.join(basePath),
+		afero:  fs.afero,
+	}, nil
+}
+
+// Root returns the root path of the filesystem.
+func (fs *SFTP) Root() string {
+	return fs.root
+}
+
+// RemoveAll removes a path and any children it contains. It does not fail
+// if the path does not exist.
+func (fs *SFTP) RemoveAll(filePath string) error {
+	return fs.afero.Fs.RemoveAll(fs.join(filePath))
+}
+
+// Capabilities implements the Capable interface. LockCapability is always
+// reported since the lockfile fallback in sftpFile.Lock/Unlock works
+// against any SFTP server, regardless of what extensions it advertises.
+func (fs *SFTP) Capabilities() billy.Capability {
+	return billy.DefaultCapabilities
+}
+
+// createDir ensures the parent directory of fullpath exists on the server.
+func (fs *SFTP) createDir(fullpath string) error {
+	dir := path.Dir(fullpath)
+	if dir != "." {
+		if err := fs.afero.Fs.MkdirAll(dir, defaultDirectoryMode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sftpFile replaces the local file lock fallback with advisory locking
+// implemented over the SFTP connection through a per-path lockfile on the
+// server; no server-side lock extension is used.
+type sftpFile struct {
+	file
+	client *sftp.Client
+	path   string
+}
+
+// Lock takes an advisory lock by creating a sibling "<name>.lock" file with
+// O_CREATE|O_EXCL, which fails if another client already holds it.
+func (f *sftpFile) Lock() error {
+	lock, err := f.client.OpenFile(f.path+lockFileSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	return lock.Close()
+}
+
+// Unlock releases a lock taken by Lock.
+func (f *sftpFile) Unlock() error {
+	return f.client.Remove(f.path + lockFileSuffix)
+}
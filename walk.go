@@ -0,0 +1,308 @@
+package afero2billy
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// WalkFunc is the type of the function called for each file or directory
+// visited by Walk and WalkParallel, mirroring afero's walk helpers. The
+// path argument contains the argument to Walk as a prefix; that is, if
+// Walk is called with root "dir", which is a directory containing the
+// file "a", the walk function will be called with argument "dir/a". The
+// info argument describes the file or directory. If an error is returned,
+// processing stops; Walk or WalkParallel returns that error.
+type WalkFunc func(fs billy.Filesystem, path string, info os.FileInfo, err error) error
+
+// Walk walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root. It stops at the first error
+// returned by fn, and shares WalkParallel's symlink-loop guard.
+func Walk(fs billy.Filesystem, root string, fn WalkFunc) error {
+	info, err := fs.Lstat(root)
+	if err != nil {
+		return fn(fs, root, nil, err)
+	}
+	return walk(fs, root, info, fn, newSymlinkGuard())
+}
+
+// walk calls fn for name, described by info, and recursively descends into
+// it if it's a directory.
+func walk(fs billy.Filesystem, name string, info os.FileInfo, fn WalkFunc, guard *symlinkGuard) error {
+	if err := fn(fs, name, info, nil); err != nil || !info.IsDir() {
+		return err
+	}
+
+	entries, err := fs.ReadDir(name)
+	if err != nil {
+		return fn(fs, name, info, err)
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(name, entry.Name())
+		entryInfo := entry
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			target, err := fs.Stat(entryPath)
+			if err != nil {
+				if err := fn(fs, entryPath, entry, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if target.IsDir() && guard.seen(fs, entryPath, target) {
+				continue
+			}
+			entryInfo = target
+		}
+
+		if err := walk(fs, entryPath, entryInfo, fn, guard); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WalkParallel walks the file tree rooted at root like Walk, but
+// distributes directory-listing work across workers goroutines, which
+// helps when fs has high per-call latency (SFTP, S3-via-afero, etc.). fn
+// is always invoked from a single goroutine at a time, so it doesn't need
+// to be safe for concurrent use. WalkParallel returns the first non-nil
+// error returned by fn; as in Walk, an error listing a directory is passed
+// to fn and stops the walk only if fn returns it. Once that happens, no
+// further paths are visited.
+func WalkParallel(fs billy.Filesystem, root string, workers int, fn WalkFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	info, err := fs.Lstat(root)
+	if err != nil {
+		return fn(fs, root, nil, err)
+	}
+
+	w := &parallelWalker{
+		fs:      fs,
+		fn:      fn,
+		pending: make(chan walkDir, workers*4),
+		guard:   newSymlinkGuard(),
+	}
+
+	w.wg.Add(1)
+	w.pending <- walkDir{path: root, info: info}
+
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go w.work(done)
+	}
+
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	<-done
+
+	return w.firstErr()
+}
+
+// walkDir is a unit of work for the parallel walker: a file or directory
+// that still needs to be visited, and listed and recursed into if it's a
+// directory.
+type walkDir struct {
+	path string
+	info os.FileInfo
+}
+
+// parallelWalker coordinates a WalkParallel run: a bounded channel of
+// pending directories feeds a pool of worker goroutines, fn is serialized
+// under callMu, and the first error stops further scheduling.
+type parallelWalker struct {
+	fs billy.Filesystem
+	fn WalkFunc
+
+	pending chan walkDir
+	wg      sync.WaitGroup
+
+	callMu sync.Mutex
+
+	errMu sync.Mutex
+	err   error
+
+	guard *symlinkGuard
+}
+
+// work drains pending directories until the walker is stopped, either by
+// an error or by running out of work.
+func (w *parallelWalker) work(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case dir, ok := <-w.pending:
+			if !ok {
+				return
+			}
+			w.visit(dir)
+			w.wg.Done()
+		}
+	}
+}
+
+// visit calls fn for dir and, if it's a directory, lists it and schedules
+// its children, skipping any symlinked subdirectory the guard has already
+// seen.
+func (w *parallelWalker) visit(dir walkDir) {
+	if w.failed() {
+		return
+	}
+
+	if err := w.call(dir.path, dir.info, nil); err != nil {
+		w.fail(err)
+		return
+	}
+
+	if !dir.info.IsDir() {
+		return
+	}
+
+	entries, err := w.fs.ReadDir(dir.path)
+	if err != nil {
+		if err := w.call(dir.path, dir.info, err); err != nil {
+			w.fail(err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(dir.path, entry.Name())
+		entryInfo := entry
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			target, err := w.fs.Stat(entryPath)
+			if err != nil {
+				if err := w.call(entryPath, entry, err); err != nil {
+					w.fail(err)
+					return
+				}
+				continue
+			}
+			if target.IsDir() && w.guard.seen(w.fs, entryPath, target) {
+				continue
+			}
+			entryInfo = target
+		}
+
+		w.wg.Add(1)
+		select {
+		case w.pending <- walkDir{path: entryPath, info: entryInfo}:
+		default:
+			// The buffered channel is full; recurse inline instead of
+			// blocking a worker that could otherwise make progress.
+			w.visit(walkDir{path: entryPath, info: entryInfo})
+			w.wg.Done()
+		}
+	}
+}
+
+// call invokes fn serialized under callMu.
+func (w *parallelWalker) call(p string, info os.FileInfo, err error) error {
+	w.callMu.Lock()
+	defer w.callMu.Unlock()
+	return w.fn(w.fs, p, info, err)
+}
+
+func (w *parallelWalker) fail(err error) {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *parallelWalker) failed() bool {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err != nil
+}
+
+func (w *parallelWalker) firstErr() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err
+}
+
+// symlinkGuard tracks directories reached through a symlink, so Walk and
+// WalkParallel can detect a symlink loop (e.g. a self-referential
+// "a/loop -> .") instead of recursing forever.
+//
+// os.SameFile, which compares the (dev, ino) pair in os.FileInfo.Sys(),
+// only ever returns true when both arguments are backed by the stdlib's
+// own os package; billy filesystems backed by SFTP, S3, or anything else
+// afero wraps have no such identity available. For those, the guard falls
+// back to the path a symlink's target resolves to: a self-referential
+// symlink always resolves to the same target path, so that's enough to
+// break the loop even without true inode identity.
+type symlinkGuard struct {
+	mu    sync.Mutex
+	infos []os.FileInfo
+	// paths maps each resolved target, and each symlink path followed to
+	// reach one, to that resolved target.
+	paths map[string]string
+}
+
+func newSymlinkGuard() *symlinkGuard {
+	return &symlinkGuard{paths: make(map[string]string)}
+}
+
+// seen reports whether the directory target, reached via the symlink at
+// linkPath, has already been visited by this walk, recording it if not.
+func (g *symlinkGuard) seen(fs billy.Filesystem, linkPath string, target os.FileInfo) bool {
+	resolved, err := resolveSymlink(fs, linkPath)
+	if err != nil {
+		resolved = linkPath
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// A relative target is resolved against linkPath's directory, which may
+	// itself lie under a symlink this walk already followed (e.g. the
+	// "a/loop" in "a/loop/loop"); map that prefix back to its target.
+	for p := resolved; p != "." && p != "/"; p = path.Dir(p) {
+		if canon, ok := g.paths[p]; ok {
+			resolved = path.Join(canon, strings.TrimPrefix(resolved, p))
+			break
+		}
+	}
+
+	for _, info := range g.infos {
+		if os.SameFile(info, target) {
+			return true
+		}
+	}
+	if _, ok := g.paths[resolved]; ok {
+		return true
+	}
+
+	g.infos = append(g.infos, target)
+	g.paths[resolved] = resolved
+	g.paths[linkPath] = resolved
+	return false
+}
+
+// resolveSymlink returns the path the symlink at linkPath points to,
+// resolving a single level (it doesn't follow a chain of symlinks).
+func resolveSymlink(fs billy.Filesystem, linkPath string) (string, error) {
+	target, err := fs.Readlink(linkPath)
+	if err != nil {
+		return "", err
+	}
+	if path.IsAbs(target) {
+		return path.Clean(target), nil
+	}
+	return path.Clean(path.Join(path.Dir(linkPath), target)), nil
+}